@@ -9,13 +9,47 @@ const getDefault = (value: any, defaultValue: any) => {
   return value;
 };
 
+const NODE_ENV = getDefault(process.env.NODE_ENV, 'development');
+
+const JWT_SECRET = getDefault(process.env.JWT_SECRET, 'REDACTED');
+
+// the built-in default and the secrets checked in with .env and sample.env are public
+const PUBLIC_JWT_SECRETS = ['REDACTED', 'example-jwt-secret'];
+
+const getList = (value: string | undefined, defaultValue: string[]) => {
+  if (!value) {
+    return defaultValue;
+  }
+  return value.split(',').map(item => item.trim()).filter(item => item.length > 0);
+};
+
 export const config = {
+  NODE_ENV,
   DB_URL: getDefault(process.env.DB_URL, 'mongodb://localhost:27017/power-grid'),
-  JWT_SECRET: getDefault(process.env.JWT_SECRET, 'REDACTED'),
-  API_PORT: process.env.API_PORT ? Number.parseInt(process.env.API_PORT, 10) : 8080,
+  DB_NAME: getDefault(process.env.DB_NAME, 'power-grid-game'),
+  DB_DEBUG: process.env.DB_DEBUG ? process.env.DB_DEBUG === 'true' : true,
+  JWT_SECRET,
+  // anyone can sign tokens with a public secret, so they can't be trusted for anything privileged
+  JWT_SECRET_IS_DEFAULT: PUBLIC_JWT_SECRETS.includes(JWT_SECRET),
+  API_PORT: Number.parseInt(getDefault(process.env.API_PORT, getDefault(process.env.PORT, '8080')), 10),
   SOCKET_PORT: process.env.SOCKET_PORT ? Number.parseInt(process.env.SOCKET_PORT, 10) : 65080,
+  SOCKET_PING_INTERVAL: process.env.SOCKET_PING_INTERVAL ? Number.parseInt(process.env.SOCKET_PING_INTERVAL, 10) : 25000,
+  SOCKET_PING_TIMEOUT: process.env.SOCKET_PING_TIMEOUT ? Number.parseInt(process.env.SOCKET_PING_TIMEOUT, 10) : 20000,
   REDIS_PORT: process.env.REDIS_PORT ? Number.parseInt(process.env.REDIS_PORT, 10) : 6379,
   REDIS_HOST: getDefault(process.env.REDIS_HOST, 'localhost'),
 
+  MOTD: getDefault(process.env.MOTD, ''),
+  // minutes an unstarted game may sit idle before it is removed
+  LOBBY_TIMEOUT: process.env.LOBBY_TIMEOUT ? Number.parseInt(process.env.LOBBY_TIMEOUT, 10) : 60,
+
+  // usernames whose tokens may call /admin
+  ADMIN_USERS: getList(process.env.ADMIN_USERS, []),
+
   SALT_ROUNDS: process.env.SALT_ROUNDS ? Number.parseInt(process.env.SALT_ROUNDS, 10) : 6,
+
+  // set when running behind a reverse proxy so IP bans see the client's address, not the proxy's
+  TRUST_PROXY: process.env.TRUST_PROXY === 'true',
+
+  // comma separated origins, '*' allows any; production denies cross-origin unless listed
+  CORS_ORIGINS: getList(process.env.CORS_ORIGINS, NODE_ENV === 'production' ? [] : ['*']),
 };
\ No newline at end of file
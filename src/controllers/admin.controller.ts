@@ -0,0 +1,216 @@
+import debug from 'debug';
+import { Dictionary, QueryOrder } from '@mikro-orm/core';
+import { ObjectId } from '@mikro-orm/mongodb';
+import { Request, Response } from 'express';
+import Router from 'express-promise-router';
+import { clientAddress, DI, io, sessionStats, socketHandlerCrashes } from '../server';
+import { config } from '../config';
+import { Ban, Game, Player } from '../entities';
+import { admin, recentErrors, ErrorCode, ErrorHandler } from '../middleware';
+import { expiredGames } from '../managers/lobbyManager';
+import { generateRandomNumber } from './game.controller';
+
+const router = Router();
+
+router.use(admin);
+
+// started games are never cleaned up, so only the most recently updated ones are listed in full
+const OVERVIEW_GAMES = 50;
+
+router.get('/overview', async (req: Request, res: Response) => {
+  const [games, waiting, inProgress] = await Promise.all([
+    DI.gameRepository.find({}, { populate: ['players'], orderBy: { updatedAt: QueryOrder.DESC }, limit: OVERVIEW_GAMES }),
+    DI.gameRepository.count({ gamePhase: 0 }),
+    DI.gameRepository.count({ gamePhase: { $gt: 0 } }),
+  ]);
+  const sockets = await io.fetchSockets();
+
+  res.json({
+    sockets: sockets.map(socket => ({ id: socket.id, address: clientAddress(socket.handshake) })),
+    gameCounts: { waiting, inProgress },
+    games: games.map(game => ({
+      code: game.code,
+      host: game.host,
+      players: game.players.count(),
+      phase: game.gamePhase,
+      round: game.roundStep,
+      isPrivate: game.isPrivate,
+      updatedAt: game.updatedAt,
+    })),
+    database: {
+      connected: await DI.orm.isConnected(),
+      expiredGames,
+    },
+    socketHandlerCrashes,
+    recentErrors,
+  });
+});
+
+router.get('/sessions', (req: Request, res: Response) => {
+  res.json(Array.from(sessionStats.values()));
+});
+
+router.get('/bans', async (req: Request, res: Response) => {
+  res.json(await DI.banRepository.findAll({ orderBy: { createdAt: QueryOrder.DESC } }));
+});
+
+// body: { playerName?, ip?, reason, days? } - omitting days makes the ban permanent
+router.post('/bans', async (req: Request, res: Response) => {
+  const { playerName, ip, reason, days } = req.body;
+  if (!playerName && !ip) {
+    throw new ErrorHandler(400, 'a ban needs a `playerName` or an `ip`');
+  }
+  if (!reason) {
+    throw new ErrorHandler(400, '`reason` is missing');
+  }
+  if (days !== undefined && !(Number.isFinite(Number(days)) && Number(days) > 0)) {
+    throw new ErrorHandler(400, '`days` must be a positive number', ErrorCode.INVALID_REQUEST, { days });
+  }
+
+  const ban = new Ban(reason, res.locals.username);
+  ban.playerName = playerName;
+  ban.ip = ip;
+  if (days !== undefined) {
+    ban.expiresAt = new Date(Date.now() + Number(days) * 24 * 60 * 60 * 1000);
+  }
+  await DI.banRepository.persist(ban).flush();
+
+  res.json(ban);
+});
+
+router.delete('/bans/:id', async (req: Request, res: Response) => {
+  const ban = ObjectId.isValid(req.params.id) ? await DI.banRepository.findOne(req.params.id) : null;
+  if (!ban) {
+    throw new ErrorHandler(404, 'ban not found', ErrorCode.BAN_NOT_FOUND, { id: req.params.id });
+  }
+
+  await DI.banRepository.remove(ban).flush();
+  res.json({ removed: req.params.id });
+});
+
+router.get('/reports', async (req: Request, res: Response) => {
+  const where = req.query.all === 'true' ? {} : { resolved: false };
+  res.json(await DI.reportRepository.find(where, { orderBy: { createdAt: QueryOrder.DESC } }));
+});
+
+router.post('/reports/:id/resolve', async (req: Request, res: Response) => {
+  const report = ObjectId.isValid(req.params.id) ? await DI.reportRepository.findOne(req.params.id) : null;
+  if (!report) {
+    throw new ErrorHandler(404, 'report not found', ErrorCode.REPORT_NOT_FOUND, { id: req.params.id });
+  }
+
+  report.resolved = true;
+  report.resolution = req.body.resolution;
+  await DI.reportRepository.flush();
+  res.json(report);
+});
+
+// full snapshot including the hidden deck order, for reproducing bugs on a dev server
+router.get('/games/:code/export', async (req: Request, res: Response) => {
+  const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
+  if (!game) {
+    throw new ErrorHandler(404, 'game not found', ErrorCode.GAME_NOT_FOUND, { code: req.params.code });
+  }
+
+  res.json({
+    sensitive: true,
+    exportedAt: new Date(),
+    game: {
+      code: game.code,
+      host: game.host,
+      isPrivate: game.isPrivate,
+      turnOrder: game.turnOrder,
+      gamePhase: game.gamePhase,
+      roundStep: game.roundStep,
+      discard: game.discard,
+      deck: game.deck,
+      market: game.market,
+      bidState: game.bidState,
+      resourceState: game.resourceState,
+      preset: game.preset,
+      settings: game.settings,
+    },
+    players: game.players.getItems().map(player => ({
+      name: player.name,
+      money: player.money,
+      houses: player.houses,
+      powerPlants: player.powerPlants,
+    })),
+  });
+});
+
+// the game state fields /games/:code/export writes out; anything else in a snapshot is ignored
+const IMPORTED_FIELDS: (keyof Game)[] = [
+  'isPrivate',
+  'turnOrder',
+  'gamePhase',
+  'roundStep',
+  'discard',
+  'deck',
+  'market',
+  'bidState',
+  'resourceState',
+  'preset',
+  'settings',
+];
+
+const IMPORTED_PLAYER_FIELDS: (keyof Player)[] = ['money', 'houses', 'powerPlants'];
+
+// only the name is required; fields left out keep the Player defaults
+const isImportedPlayer = (entry: any) =>
+  entry && typeof entry.name === 'string' && entry.name.length > 0
+    && (entry.money === undefined || typeof entry.money === 'number')
+    && (entry.houses === undefined || Array.isArray(entry.houses))
+    && (entry.powerPlants === undefined || Array.isArray(entry.powerPlants));
+
+router.post('/games/import', async (req: Request, res: Response) => {
+  if (config.NODE_ENV === 'production') {
+    throw new ErrorHandler(403, 'game import is disabled in production', ErrorCode.FORBIDDEN);
+  }
+
+  const { game: snapshot, players } = req.body;
+  if (!snapshot || !snapshot.host || !Array.isArray(players)) {
+    throw new ErrorHandler(400, 'expected an exported game snapshot');
+  }
+
+  const malformed = players.findIndex(entry => !isImportedPlayer(entry));
+  if (malformed !== -1) {
+    throw new ErrorHandler(400, 'each player needs a name, numeric money and houses/powerPlants arrays', ErrorCode.INVALID_REQUEST, { index: malformed });
+  }
+
+  const { code, host } = snapshot;
+  const game = new Game(generateRandomNumber(5), host);
+  IMPORTED_FIELDS
+    .filter(field => snapshot[field] !== undefined)
+    .forEach(field => Object.assign(game, { [field]: snapshot[field] }));
+  players.forEach((entry: Dictionary) => {
+    const player = game.players.getItems().find(existing => existing.name === entry.name) || new Player(entry.name, game);
+    IMPORTED_PLAYER_FIELDS
+      .filter(field => entry[field] !== undefined)
+      .forEach(field => Object.assign(player, { [field]: entry[field] }));
+    game.players.add(player);
+  });
+  await DI.gameRepository.persist(game).flush();
+
+  res.json({ importedFrom: code, game });
+});
+
+// debug namespaces currently enabled, e.g. "app:*,-app:lobby"
+let logNamespaces = process.env.DEBUG || '';
+
+router.get('/log', (req: Request, res: Response) => {
+  res.json({ namespaces: logNamespaces });
+});
+
+router.put('/log', (req: Request, res: Response) => {
+  const { namespaces } = req.body;
+  if (typeof namespaces !== 'string') {
+    throw new ErrorHandler(400, '`namespaces` must be a string');
+  }
+
+  debug.enable(namespaces);
+  logNamespaces = namespaces;
+  res.json({ namespaces: logNamespaces });
+});
+
+export const AdminController = router;
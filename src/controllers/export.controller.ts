@@ -0,0 +1,104 @@
+import { Dictionary, QueryOrder } from '@mikro-orm/core';
+import { ObjectId } from '@mikro-orm/mongodb';
+import { Request, Response } from 'express';
+import Router from 'express-promise-router';
+import { DI } from '../server';
+import { authenticated, isAdmin, ErrorHandler } from '../middleware';
+
+type Row = Record<string, string | number | Date>;
+
+const MAX_LIMIT = 5000;
+
+const escapeCsv = (value: string | number | Date) => {
+  const text = value instanceof Date ? value.toISOString() : String(value);
+  return /[",\n]/.test(text) ? `"${text.replace(/"/g, '""')}"` : text;
+};
+
+const loadRows = async (entity: string, where: Dictionary, limit: number): Promise<Row[]> => {
+  const options = { orderBy: { _id: QueryOrder.ASC }, limit };
+  if (entity === 'games') {
+    const games = await DI.gameRepository.find(where, { ...options, populate: ['players'] });
+    return games.map(game => ({
+      id: game.id,
+      code: game.code,
+      host: game.host,
+      gamePhase: game.gamePhase,
+      roundStep: game.roundStep,
+      players: game.players.count(),
+      createdAt: game.createdAt,
+      updatedAt: game.updatedAt,
+    }));
+  }
+
+  const players = await DI.playerRepository.find(where, { ...options, populate: ['game'] });
+  return players.map(player => ({
+    id: player.id,
+    game: player.game.code,
+    name: player.name,
+    money: player.money,
+    cities: player.houses.length,
+    powerPlants: player.powerPlants.length,
+    createdAt: player.createdAt,
+  }));
+};
+
+const router = Router();
+
+router.use(authenticated);
+
+// GET /export?entity=games|participants&format=csv|ndjson&days=N&limit=N&cursor=<id>
+router.get('/', async (req: Request, res: Response) => {
+  const entity = String(req.query.entity || 'games');
+  const format = String(req.query.format || 'ndjson');
+  if (!['games', 'participants'].includes(entity)) {
+    throw new ErrorHandler(400, `unsupported entity: ${entity}`);
+  }
+  if (!['csv', 'ndjson'].includes(format)) {
+    throw new ErrorHandler(400, `unsupported format: ${format}`);
+  }
+
+  const limit = Math.max(Math.min(Number.parseInt(String(req.query.limit || MAX_LIMIT), 10) || MAX_LIMIT, MAX_LIMIT), 1);
+  const where: Dictionary = {};
+  if (req.query.days) {
+    const days = Number(req.query.days);
+    if (!Number.isFinite(days) || days <= 0) {
+      throw new ErrorHandler(400, '`days` must be a positive number');
+    }
+    where.createdAt = { $gte: new Date(Date.now() - days * 24 * 60 * 60 * 1000) };
+  }
+  if (req.query.cursor) {
+    if (!ObjectId.isValid(String(req.query.cursor))) {
+      throw new ErrorHandler(400, 'invalid cursor');
+    }
+    where._id = { $gt: new ObjectId(String(req.query.cursor)) };
+  }
+  // private games are left out unless an admin is asking
+  if (!isAdmin(res.locals.username)) {
+    if (entity === 'games') {
+      where.isPrivate = { $ne: true };
+    } else {
+      const hidden = await DI.gameRepository.find({ isPrivate: true });
+      where.game = { $nin: hidden.map(game => game._id) };
+    }
+  }
+
+  const rows = await loadRows(entity, where, limit);
+  if (rows.length === limit) {
+    res.set('X-Next-Cursor', String(rows[rows.length - 1].id));
+  }
+
+  if (format === 'csv') {
+    res.type('text/csv');
+    if (rows.length) {
+      const columns = Object.keys(rows[0]);
+      res.write(`${columns.join(',')}\n`);
+      rows.forEach(row => res.write(`${columns.map(column => escapeCsv(row[column])).join(',')}\n`));
+    }
+  } else {
+    res.type('application/x-ndjson');
+    rows.forEach(row => res.write(`${JSON.stringify(row)}\n`));
+  }
+  res.end();
+});
+
+export const ExportController = router;
@@ -1,10 +1,15 @@
-import { Dictionary, QueryOrder, wrap } from '@mikro-orm/core';
+import { Dictionary, EntityManager, QueryOrder, wrap } from '@mikro-orm/core';
 import { Request, Response } from 'express';
 import Router from 'express-promise-router';
 import { DI } from '../server';
 import { Game, Player } from '../entities';
+import { ErrorCode, ErrorHandler } from '../middleware';
+import { regionsForPlayers } from '../managers/mapManager';
+import { assertNotBanned, isPlayerName } from '../managers/moderationManager';
+import { isGamePreset, presetSettings } from '../presets';
+import { GamePreset } from '../types';
 
-function generateRandomNumber(numberOfCharacters: number) {
+export function generateRandomNumber(numberOfCharacters: number) {
    let randomValues = '';
    const stringValues = 'ABCDEFGHIJKLMNOPQRSTUVWXYZ';  
    const sizeOfCharacter = stringValues.length;  
@@ -14,116 +19,262 @@ for (var i = 0; i < numberOfCharacters; i++) {
    return randomValues;
 } 
 
+const MIN_PLAYERS = 2;
+const MAX_PLAYERS = 6;
+
+const addPlayer = (game: Game, name: string) => {
+  if (game.players.count() >= MAX_PLAYERS) {
+    throw new ErrorHandler(400, 'max players reached', ErrorCode.GAME_FULL);
+  }
+
+  const playerNames = game.players.getItems().map(player => player.name);
+
+  if (playerNames.includes(name)) {
+    throw new ErrorHandler(400, `player: ${name} already exists in game`, ErrorCode.PLAYER_EXISTS, { name });
+  }
+
+  game.players.add(new Player(name, game));
+};
+
+const ACTIVE_STREAM_INTERVAL = 5000;
+
+const activeSummaries = async (em: EntityManager) => {
+  const games = await em.find(Game, { gamePhase: { $gt: 0 }, isPrivate: { $ne: true } }, { populate: ['players'], orderBy: { updatedAt: QueryOrder.DESC } });
+  return games.map(game => ({
+    code: game.code,
+    host: game.host,
+    round: game.roundStep,
+    phase: game.gamePhase,
+    players: game.players.getItems().map(player => ({ name: player.name, cities: player.houses.length })),
+    updatedAt: game.updatedAt,
+  }));
+};
+
 const router = Router();
 
+// GET /game?status=waiting|in_progress&open=true&host=<name>&player=<name>&from=<date>&to=<date>
+//   &sort=newest|fill&page=N&limit=N
 router.get('/', async (req: Request, res: Response) => {
-    const games = await DI.gameRepository.findAll(['players'], { code: QueryOrder.DESC }, 20);
-    res.json(games);
+  const where: Dictionary = { isPrivate: { $ne: true } };
+  if (req.query.status === 'waiting') {
+    where.gamePhase = 0;
+  } else if (req.query.status === 'in_progress') {
+    where.gamePhase = { $gt: 0 };
+  }
+  if (req.query.host) {
+    where.host = String(req.query.host);
+  }
+  if (req.query.player) {
+    const entries = await DI.playerRepository.find({ name: String(req.query.player) });
+    where._id = { $in: entries.map(entry => entry.game._id) };
+  }
+  if (req.query.from || req.query.to) {
+    const from = req.query.from ? new Date(String(req.query.from)) : undefined;
+    const to = req.query.to ? new Date(String(req.query.to)) : undefined;
+    if ((from && Number.isNaN(from.getTime())) || (to && Number.isNaN(to.getTime()))) {
+      throw new ErrorHandler(400, '`from` and `to` must be dates');
+    }
+    where.createdAt = { ...(from && { $gte: from }), ...(to && { $lte: to }) };
+  }
+
+  const limit = Math.max(Math.min(Number.parseInt(String(req.query.limit || 20), 10) || 20, 100), 1);
+  const page = Math.max(Number.parseInt(String(req.query.page || 1), 10) || 1, 1);
+  const orderBy = { createdAt: QueryOrder.DESC };
+
+  if (req.query.open !== 'true' && req.query.sort !== 'fill') {
+    const [games, total] = await DI.gameRepository.findAndCount(where, { populate: ['players'], orderBy, limit, offset: (page - 1) * limit });
+    res.set('X-Total-Count', String(total));
+    return res.json(games);
+  }
+
+  // open and fill depend on player counts, so rank partial rows in a fork and only load the page in full
+  const em = DI.orm.em.fork();
+  const candidates = await em.find(Game, where, { fields: ['gamePhase', 'createdAt'], orderBy });
+  const entries = await em.find(Player, { game: { $in: candidates.map(game => game._id) } }, { fields: ['game'] });
+  const counts = new Map<string, number>();
+  entries.forEach(entry => counts.set(entry.game.id, (counts.get(entry.game.id) || 0) + 1));
+  const playerCount = (game: Game) => counts.get(game.id) || 0;
+
+  let ranked = candidates;
+  if (req.query.open === 'true') {
+    ranked = ranked.filter(game => game.gamePhase === 0 && playerCount(game) < MAX_PLAYERS);
+  }
+  if (req.query.sort === 'fill') {
+    ranked = [...ranked].sort((a, b) => playerCount(b) - playerCount(a));
+  }
+
+  const pageOf = ranked.slice((page - 1) * limit, page * limit);
+  const games = await DI.gameRepository.find({ _id: { $in: pageOf.map(game => game._id) } }, ['players']);
+  res.set('X-Total-Count', String(ranked.length));
+  res.json(pageOf.map(({ id }) => games.find(game => game.id === id)));
 });
 
 router.post('/', async (req: Request, res: Response) => {
-  if (!req.body.host) {
-    res.status(400);
-    return res.json({ message: '`host` is missing' });
+  if (!isPlayerName(req.body.host)) {
+    throw new ErrorHandler(400, '`host` must be a non-empty string');
   }
+  await assertNotBanned(DI.em, { name: req.body.host, ip: req.ip });
 
-  try {
-    const { host } = req.body;
-    const code = generateRandomNumber(5);
-    const game = new Game(code, host);
-    wrap(game).assign(req.body);
-    await DI.gameRepository.persist(game).flush();
-    res.json(game);
-  } catch(e) {
-    return res.status(400).json({ message: e.message});
+  const { host, preset = GamePreset.STANDARD } = req.body;
+  if (!isGamePreset(preset)) {
+    throw new ErrorHandler(400, `unknown preset: ${preset}`, ErrorCode.INVALID_REQUEST, { presets: Object.values(GamePreset) });
   }
+
+  const code = generateRandomNumber(5);
+  const game = new Game(code, host);
+  wrap(game).assign(req.body);
+  // settings always come from the preset, never straight from the request
+  game.preset = preset;
+  game.settings = presetSettings(preset);
+  await DI.gameRepository.persist(game).flush();
+  res.json(game);
 }); 
 
-router.get('/:code', async (req: Request, res: Response) => {
-  try {
-    const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
-    if (!game) {
-      return res.status(404).json({ message: 'game not found' });
+router.get('/active', async (req: Request, res: Response) => {
+  res.json(await activeSummaries(DI.em));
+});
+
+// server-sent events variant; each tick uses a fresh fork so the identity map can't serve stale games
+router.get('/active/stream', async (req: Request, res: Response) => {
+  res.set({
+    'Content-Type': 'text/event-stream',
+    'Cache-Control': 'no-cache',
+    Connection: 'keep-alive',
+  });
+  res.flushHeaders();
+
+  // the client may leave while a query is still running, so check before every write
+  const send = async () => {
+    try {
+      const summaries = await activeSummaries(DI.orm.em.fork());
+      if (!res.writableEnded) {
+        res.write(`data: ${JSON.stringify(summaries)}\n\n`);
+      }
+    } catch (e) {
+      console.error(e);
+      if (!res.writableEnded) {
+        res.write(`event: error\ndata: ${JSON.stringify({ code: ErrorCode.INTERNAL, message: 'internal error' })}\n\n`);
+      }
     }
+  };
 
-    res.json(game);
-  } catch(e) {
-    return res.status(400).json({ message: e.message });
-  }
+  const timer = setInterval(send, ACTIVE_STREAM_INTERVAL);
+  req.on('close', () => {
+    clearInterval(timer);
+    res.end();
+  });
+  await send();
 });
 
-router.post('/:code/add_player', async (req: Request, res: Response) => {
+// joins the fullest open public game (within the preferred size, if given) or hosts a new one
+router.post('/quick_play', async (req: Request, res: Response) => {
   const { name } = req.body;
-  if (!name) {
-    res.status(400).json({ message: 'missing player name' });
+  if (!isPlayerName(name)) {
+    throw new ErrorHandler(400, 'player name must be a non-empty string');
+  }
+  await assertNotBanned(DI.em, { name, ip: req.ip });
+  const preferred = req.body.players === undefined ? MAX_PLAYERS : Number(req.body.players);
+  if (!Number.isInteger(preferred) || preferred < MIN_PLAYERS || preferred > MAX_PLAYERS) {
+    throw new ErrorHandler(400, `\`players\` must be between ${MIN_PLAYERS} and ${MAX_PLAYERS}`, ErrorCode.INVALID_REQUEST, { players: req.body.players });
   }
 
-  try {
-    const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
-    if (!game) {
-      return res.status(404).json({ message: 'game not found' });
-    }
+  const candidates = await DI.gameRepository.find({ gamePhase: 0, isPrivate: { $ne: true } }, ['players']);
+  const game = candidates
+    .filter(candidate => candidate.players.count() < preferred)
+    .filter(candidate => !candidate.players.getItems().some(player => player.name === name))
+    .sort((a, b) => b.players.count() - a.players.count())[0];
 
-    if (game.players.count() == 6) {
-      return res.status(400).json({ message: 'max players reached'});
-    }
+  if (!game) {
+    const created = new Game(generateRandomNumber(5), name);
+    await DI.gameRepository.persist(created).flush();
+    return res.json(created);
+  }
 
-    const playerNames = game.players.toArray().map((player: Dictionary<Player>) => player.name);
+  addPlayer(game, name);
+  await DI.gameRepository.flush();
+  res.json(game);
+});
 
-    if (playerNames.includes(name)) {
-      return res.status(400).json({ message: `player: ${name} already exists in game`});
-    }
+router.get('/:code', async (req: Request, res: Response) => {
+  const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
+  if (!game) {
+    throw new ErrorHandler(404, 'game not found', ErrorCode.GAME_NOT_FOUND, { code: req.params.code });
+  }
 
-    const player = new Player(name, game);
-    game.players.add(player);
-    await DI.gameRepository.flush();
+  res.json(game);
+});
 
-    res.json(game);
-  } catch(e) {
-    return res.status(400).json({ message: e.message });
+router.get('/:code/card', async (req: Request, res: Response) => {
+  const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
+  if (!game) {
+    throw new ErrorHandler(404, 'game not found', ErrorCode.GAME_NOT_FOUND, { code: req.params.code });
   }
+
+  const status = game.gamePhase > 0 ? 'in_progress' : 'waiting';
+  res.set('Cache-Control', 'public, max-age=30');
+
+  if (game.isPrivate) {
+    return res.json({ code: game.code, status, private: true });
+  }
+
+  const players = game.players.getItems().map(player => ({
+    name: player.name,
+    cities: player.houses.length,
+  }));
+  const leader = game.gamePhase > 0 && players.length
+    ? players.reduce((best, player) => player.cities > best.cities ? player : best).name
+    : null;
+
+  res.json({
+    code: game.code,
+    status,
+    host: game.host,
+    players,
+    round: game.roundStep,
+    phase: game.gamePhase,
+    preset: game.preset,
+    leader,
+    map: { name: 'usa', thumbnail: 'images/power-grid-usa.jpg' },
+  });
 });
 
-router.post('/:code/start_game', async (req: Request, res: Response) => {
-  try {
-    const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
-    if (!game) {
-      return res.status(404).json({ message: 'game not found' });
-    }
+router.post('/:code/add_player', async (req: Request, res: Response) => {
+  const { name } = req.body;
+  if (!isPlayerName(name)) {
+    throw new ErrorHandler(400, 'player name must be a non-empty string');
+  }
+  await assertNotBanned(DI.em, { name, ip: req.ip });
 
-    if (game.gamePhase > 0) {
-      return res.status(400).json({ message: 'game already started'});
-    }
+  const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
+  if (!game) {
+    throw new ErrorHandler(404, 'game not found', ErrorCode.GAME_NOT_FOUND, { code: req.params.code });
+  }
 
-    if (game.players.count() < 2) {
-      return res.status(400).json({ message: 'not enough players to start game'});
-    }
+  addPlayer(game, name);
+  await DI.gameRepository.flush();
 
-    game.gamePhase = 1;
-    let regions: number;
-    switch(game.players.count()) {
-      case 2:
-        regions = 3;
-        break;
-      case 3:
-        regions = 3;
-        break;
-      case 4:
-        regions = 4;
-        break;
-      case 5:
-        regions = 5;
-        break;
-      case 6:
-        regions = 5;
-        break;
-    }
-    await DI.gameRepository.flush();
+  res.json(game);
+});
 
-    res.json(game);
-  } catch(e) {
-    return res.status(400).json({ message: e.message });
+router.post('/:code/start_game', async (req: Request, res: Response) => {
+  const game = await DI.gameRepository.findOne({ code: req.params.code }, ['players']);
+  if (!game) {
+    throw new ErrorHandler(404, 'game not found', ErrorCode.GAME_NOT_FOUND, { code: req.params.code });
+  }
+
+  if (game.gamePhase > 0) {
+    throw new ErrorHandler(400, 'game already started', ErrorCode.GAME_ALREADY_STARTED);
   }
+
+  if (game.players.count() < MIN_PLAYERS) {
+    throw new ErrorHandler(400, 'not enough players to start game', ErrorCode.NOT_ENOUGH_PLAYERS, { players: game.players.count() });
+  }
+
+  game.gamePhase = 1;
+  const regions = regionsForPlayers(game.players.count());
+  await DI.gameRepository.flush();
+
+  res.json(game);
 });
 
 export const GameController = router;
\ No newline at end of file
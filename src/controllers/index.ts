@@ -1,2 +1,5 @@
+export * from './admin.controller';
+export * from './export.controller';
 export * from './game.controller';
-export * from './player.controller';
\ No newline at end of file
+export * from './map.controller';
+export * from './player.controller';
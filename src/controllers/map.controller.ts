@@ -0,0 +1,30 @@
+import { Request, Response } from 'express';
+import Router from 'express-promise-router';
+import { ErrorCode, ErrorHandler } from '../middleware';
+import { validateMap } from '../managers/mapManager';
+import { CityState } from '../types';
+
+const isConnection = (connection: any) =>
+  connection && typeof connection.name === 'string' && typeof connection.cost === 'number';
+
+const isCity = (city: any): city is CityState =>
+  city && typeof city.name === 'string' && typeof city.region === 'number'
+    && Array.isArray(city.connections) && city.connections.every(isConnection);
+
+const router = Router();
+
+router.post('/validate', async (req: Request, res: Response) => {
+  const cities = Array.isArray(req.body) ? req.body : req.body.cities;
+  if (!Array.isArray(cities) || !cities.length) {
+    throw new ErrorHandler(400, '`cities` must be a non-empty array');
+  }
+
+  const malformed = cities.findIndex(city => !isCity(city));
+  if (malformed !== -1) {
+    throw new ErrorHandler(400, 'each city needs a name, numeric region and connections with a name and numeric cost', ErrorCode.INVALID_REQUEST, { index: malformed });
+  }
+
+  res.json(validateMap(cities));
+});
+
+export const MapController = router;
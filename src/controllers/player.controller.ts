@@ -2,7 +2,15 @@ import { QueryOrder } from '@mikro-orm/core';
 import { Request, Response } from 'express';
 import Router from 'express-promise-router';
 import { DI } from '../server';
-import { Player } from '../entities';
+import { Player, Report } from '../entities';
+import { admin, verifyToken, ErrorCode, ErrorHandler } from '../middleware';
+import { assertNotBanned, isPlayerName } from '../managers/moderationManager';
+
+const REPORT_WINDOW = 60 * 60 * 1000;
+const REPORTS_PER_WINDOW = 5;
+
+// report timestamps per IP within the current window
+const recentReports = new Map<string, number[]>();
 
 const router = Router();
 
@@ -12,4 +20,99 @@ router.get('/', async (req: Request, res: Response) => {
     // test 1
 });
 
+router.get('/:name/profile', async (req: Request, res: Response) => {
+  const { name } = req.params;
+  const entries = await DI.playerRepository.find({ name }, { populate: ['game'], orderBy: { createdAt: QueryOrder.DESC } });
+  if (!entries.length) {
+    throw new ErrorHandler(404, 'player not found', ErrorCode.PLAYER_NOT_FOUND, { name });
+  }
+
+  // private games only show up on your own profile
+  const decoded = verifyToken(req.headers.authorization || '') as { username?: string } | false;
+  const visible = decoded && decoded.username === name ? entries : entries.filter(entry => !entry.game.isPrivate);
+
+  const games = visible.map(entry => entry.game);
+  res.json({
+    name,
+    gamesPlayed: games.length,
+    gamesHosted: games.filter(game => game.host === name).length,
+    gamesInProgress: games.filter(game => game.gamePhase > 0).length,
+    recentGames: visible.slice(0, 10).map(entry => ({
+      code: entry.game.code,
+      host: entry.game.host,
+      phase: entry.game.gamePhase,
+      round: entry.game.roundStep,
+      money: entry.money,
+      cities: entry.houses.length,
+      joinedAt: entry.createdAt,
+    })),
+  });
+});
+
+// operator action for data deletion requests, since players have no way to get a token of their own;
+// anonymizes rather than deletes so games the player took part in stay intact;
+// bans keep the original name, since they're moderation records and renaming them would lift them
+router.delete('/:name/data', admin, async (req: Request, res: Response) => {
+  const { name } = req.params;
+  const entries = await DI.playerRepository.find({ name }, { populate: ['game'] });
+  if (!entries.length) {
+    throw new ErrorHandler(404, 'player not found', ErrorCode.PLAYER_NOT_FOUND, { name });
+  }
+
+  const reports = await DI.reportRepository.find({ $or: [{ reporter: name }, { reported: name }] });
+
+  const alias = `deleted-${entries[0].id.slice(-6)}`;
+  entries.forEach(entry => {
+    entry.name = alias;
+    if (entry.game.host === name) {
+      entry.game.host = alias;
+    }
+  });
+  reports.forEach(report => {
+    if (report.reporter === name) {
+      report.reporter = alias;
+    }
+    if (report.reported === name) {
+      report.reported = alias;
+    }
+  });
+  await DI.em.flush();
+
+  res.json({ anonymized: entries.length, reports: reports.length });
+});
+
+// files a moderation ticket against :name; body: { reporter, reason, game? }
+// players identify by name like everywhere else, so reports are capped per IP instead
+router.post('/:name/report', async (req: Request, res: Response) => {
+  const { reporter, reason, game } = req.body;
+  if (!isPlayerName(reporter)) {
+    throw new ErrorHandler(400, '`reporter` must be a non-empty string');
+  }
+  if (typeof reason !== 'string' || !reason) {
+    throw new ErrorHandler(400, '`reason` is missing');
+  }
+  if (game !== undefined && typeof game !== 'string') {
+    throw new ErrorHandler(400, '`game` must be a game code');
+  }
+
+  const now = Date.now();
+  recentReports.forEach((times, ip) => {
+    if (times.every(at => now - at > REPORT_WINDOW)) {
+      recentReports.delete(ip);
+    }
+  });
+  const times = (recentReports.get(req.ip) || []).filter(at => now - at <= REPORT_WINDOW);
+  if (times.length >= REPORTS_PER_WINDOW) {
+    throw new ErrorHandler(429, 'too many reports, try again later', ErrorCode.RATE_LIMITED);
+  }
+  await assertNotBanned(DI.em, { name: reporter, ip: req.ip });
+  recentReports.set(req.ip, [...times, now]);
+
+  const report = new Report(reporter, req.params.name, reason);
+  report.gameCode = game;
+  await DI.reportRepository.persist(report).flush();
+
+  res.json({ id: report.id });
+});
+
 export const PlayerController = router;
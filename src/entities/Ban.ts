@@ -0,0 +1,29 @@
+import { Entity, Index, Property } from "@mikro-orm/core";
+import { BaseEntity } from "./BaseEntity";
+
+@Entity()
+export class Ban extends BaseEntity {
+
+  @Index({ name: 'ban_player_index' })
+  @Property({ nullable: true })
+  playerName?: string;
+
+  @Index({ name: 'ban_ip_index' })
+  @Property({ nullable: true })
+  ip?: string;
+
+  @Property()
+  reason: string;
+
+  @Property()
+  issuedBy: string;
+
+  @Property({ nullable: true })
+  expiresAt?: Date;
+
+  constructor(reason: string, issuedBy: string) {
+    super();
+    this.reason = reason;
+    this.issuedBy = issuedBy;
+  }
+}
@@ -1,7 +1,8 @@
 import { Collection, Entity, Index, OneToMany, Property } from "@mikro-orm/core";
 import { Player } from ".";
 import { newDeck, newMarket} from "../deck";
-import { PowerPlant, BidState, ResourceState, Resource } from "../types";
+import { presetSettings } from "../presets";
+import { PowerPlant, BidState, ResourceState, Resource, GamePreset, GameSettings } from "../types";
 import { BaseEntity } from "./BaseEntity";
 
 @Entity()
@@ -14,6 +15,15 @@ export class Game extends BaseEntity {
   @Property()
   host: string;
 
+  @Property()
+  isPrivate: boolean;
+
+  @Property()
+  preset: GamePreset;
+
+  @Property()
+  settings: GameSettings;
+
   @Property()
   turnOrder!: string[];
 
@@ -46,6 +56,9 @@ export class Game extends BaseEntity {
     this.code = code;
     this.host = host;
     this.players.add(new Player(host, this));
+    this.isPrivate = false;
+    this.preset = GamePreset.STANDARD;
+    this.settings = presetSettings(this.preset);
     this.gamePhase = 0;
     this.roundStep = 0;
     this.deck = newDeck();
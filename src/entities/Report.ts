@@ -0,0 +1,33 @@
+import { Entity, Index, Property } from "@mikro-orm/core";
+import { BaseEntity } from "./BaseEntity";
+
+@Entity()
+export class Report extends BaseEntity {
+
+  @Property()
+  reporter: string;
+
+  @Index({ name: 'report_reported_index' })
+  @Property()
+  reported: string;
+
+  @Property()
+  reason: string;
+
+  @Property({ nullable: true })
+  gameCode?: string;
+
+  @Property()
+  resolved: boolean;
+
+  @Property({ nullable: true })
+  resolution?: string;
+
+  constructor(reporter: string, reported: string, reason: string) {
+    super();
+    this.reporter = reporter;
+    this.reported = reported;
+    this.reason = reason;
+    this.resolved = false;
+  }
+}
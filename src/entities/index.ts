@@ -1,3 +1,5 @@
 export * from './BaseEntity';
+export * from './Ban';
 export * from './Game';
-export * from './Player';
\ No newline at end of file
+export * from './Player';
+export * from './Report';
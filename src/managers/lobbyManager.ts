@@ -0,0 +1,27 @@
+import { Game } from '../entities';
+import { DI } from '../server';
+import { config } from '../config';
+
+export let expiredGames = 0;
+
+const lastActivity = (game: Game) => Math.max(
+  game.updatedAt.getTime(),
+  ...game.players.getItems().map(player => player.createdAt.getTime()),
+);
+
+// removes games that were never started and have seen no joins within LOBBY_TIMEOUT
+export const expireIdleGames = async (): Promise<string[]> => {
+  const em = DI.em.fork();
+  const cutoff = Date.now() - config.LOBBY_TIMEOUT * 60 * 1000;
+  const candidates = await em.find(Game, { gamePhase: 0, createdAt: { $lt: new Date(cutoff) } }, ['players']);
+  const idle = candidates.filter(game => lastActivity(game) < cutoff);
+
+  idle.forEach(game => {
+    game.players.getItems().forEach(player => em.remove(player));
+    em.remove(game);
+  });
+  await em.flush();
+
+  expiredGames += idle.length;
+  return idle.map(game => game.code);
+};
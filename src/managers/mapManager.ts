@@ -0,0 +1,114 @@
+import { CityState } from "../types";
+
+const REGIONS_BY_PLAYER_COUNT: Record<number, number> = {
+  2: 3,
+  3: 3,
+  4: 4,
+  5: 5,
+  6: 5,
+};
+
+export const regionsForPlayers = (playerCount: number): number => REGIONS_BY_PLAYER_COUNT[playerCount];
+
+export interface MapDiagnostics {
+  valid: boolean;
+  errors: string[];
+  warnings: string[];
+  components: string[][];
+  regions: Record<number, number>;
+  playableWith: number[];
+  adjacency: Record<string, string[]>;
+}
+
+// treats every connection as two-way, so a one-way edge still joins its cities into one component
+const findComponents = (cities: CityState[]): string[][] => {
+  const seen = new Set<string>();
+  const neighbours = new Map(cities.map(city => [city.name, new Set<string>()] as [string, Set<string>]));
+  cities.forEach(city => city.connections.forEach(connection => {
+    if (neighbours.has(connection.name)) {
+      (neighbours.get(city.name) as Set<string>).add(connection.name);
+      (neighbours.get(connection.name) as Set<string>).add(city.name);
+    }
+  }));
+  const components: string[][] = [];
+
+  cities.forEach(start => {
+    if (seen.has(start.name)) {
+      return;
+    }
+    const component: string[] = [];
+    const queue = [start.name];
+    seen.add(start.name);
+    while (queue.length) {
+      const name = queue.shift() as string;
+      component.push(name);
+      (neighbours.get(name) as Set<string>).forEach(neighbour => {
+        if (!seen.has(neighbour)) {
+          seen.add(neighbour);
+          queue.push(neighbour);
+        }
+      });
+    }
+    components.push(component);
+  });
+
+  return components;
+};
+
+export const validateMap = (cities: CityState[]): MapDiagnostics => {
+  const errors: string[] = [];
+  const warnings: string[] = [];
+
+  const names = cities.map(city => city.name);
+  const duplicates = names.filter((name, index) => names.indexOf(name) !== index);
+  new Set(duplicates).forEach(name => errors.push(`duplicate city: ${name}`));
+
+  const known = new Set(names);
+  cities.forEach(city => city.connections.forEach(connection => {
+    if (!known.has(connection.name)) {
+      errors.push(`${city.name} connects to unknown city ${connection.name}`);
+      return;
+    }
+    if (connection.cost < 0) {
+      errors.push(`${city.name} -> ${connection.name} has negative cost ${connection.cost}`);
+    }
+    const back = cities.find(other => other.name === connection.name)?.connections.find(c => c.name === city.name);
+    if (!back) {
+      warnings.push(`${city.name} -> ${connection.name} has no return connection`);
+    } else if (back.cost !== connection.cost && city.name < connection.name) {
+      warnings.push(`${city.name} <-> ${connection.name} costs differ (${connection.cost} vs ${back.cost})`);
+    }
+  }));
+
+  const components = findComponents(cities);
+  if (components.length > 1) {
+    errors.push(`map is split into ${components.length} disconnected parts`);
+  }
+
+  const regions: Record<number, number> = {};
+  cities.forEach(city => {
+    regions[city.region] = (regions[city.region] || 0) + 1;
+  });
+  const regionCount = Object.keys(regions).length;
+  const playableWith = Object.keys(REGIONS_BY_PLAYER_COUNT)
+    .map(count => Number.parseInt(count, 10))
+    .filter(count => regionCount >= regionsForPlayers(count));
+  if (!playableWith.length) {
+    errors.push(`map has ${regionCount} regions, at least ${regionsForPlayers(2)} are needed`);
+  }
+
+  const adjacency: Record<string, string[]> = {};
+  cities.forEach(city => {
+    adjacency[city.name] = city.connections.map(connection => `${connection.name} (${connection.cost})`);
+  });
+
+  return {
+    valid: errors.length === 0,
+    errors,
+    warnings,
+    components,
+    regions,
+    playableWith,
+    adjacency,
+  };
+};
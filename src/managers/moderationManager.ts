@@ -0,0 +1,31 @@
+import { Dictionary, EntityManager } from '@mikro-orm/core';
+import { Ban } from '../entities';
+import { ErrorCode, ErrorHandler } from '../middleware';
+
+// names come straight from request bodies, so anything but a string (e.g. {"$ne": null}) must never reach a query
+export const isPlayerName = (value: unknown): value is string => typeof value === 'string' && value.trim().length > 0;
+
+export const findActiveBan = async (em: EntityManager, { name, ip }: { name?: string, ip?: string }) => {
+  const targets = [
+    ...(isPlayerName(name) ? [{ playerName: name }] : []),
+    ...(typeof ip === 'string' && ip ? [{ ip }] : []),
+  ];
+  if (!targets.length) {
+    return null;
+  }
+
+  const where: Dictionary = {
+    $and: [
+      { $or: targets },
+      { $or: [{ expiresAt: null }, { expiresAt: { $gt: new Date() } }] },
+    ],
+  };
+  return em.findOne(Ban, where);
+};
+
+export const assertNotBanned = async (em: EntityManager, target: { name?: string, ip?: string }) => {
+  const ban = await findActiveBan(em, target);
+  if (ban) {
+    throw new ErrorHandler(403, 'banned', ErrorCode.BANNED, { reason: ban.reason, expiresAt: ban.expiresAt });
+  }
+};
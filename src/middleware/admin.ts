@@ -0,0 +1,25 @@
+import { NextFunction, Request, Response } from 'express';
+import { config } from '../config';
+import { verifyToken } from './authenticated';
+import { ErrorCode, ErrorHandler } from './errorHandler';
+
+// the single place that decides whether a token's username gets admin rights
+export const isAdmin = (username?: string) =>
+  !config.JWT_SECRET_IS_DEFAULT && !!username && config.ADMIN_USERS.includes(username);
+
+const admin = (request: Request, response: Response, next: NextFunction) => {
+  if (config.JWT_SECRET_IS_DEFAULT) {
+    return next(new ErrorHandler(403, 'admin access is disabled until JWT_SECRET is set to a private value', ErrorCode.FORBIDDEN));
+  }
+  const decoded = verifyToken(request.headers.authorization || '') as { username?: string } | false;
+  if (!decoded) {
+    return next(new ErrorHandler(401, 'Token not provided', ErrorCode.UNAUTHORIZED));
+  }
+  if (!isAdmin(decoded.username)) {
+    return next(new ErrorHandler(403, 'admin access required', ErrorCode.FORBIDDEN));
+  }
+  response.locals.username = decoded.username;
+  next();
+};
+
+export default admin;
@@ -1,13 +1,15 @@
 import { NextFunction, Request, Response } from 'express';
 import jwt, { VerifyErrors } from 'jsonwebtoken';
 import { config } from '../config';
+import { ErrorCode, ErrorHandler } from './errorHandler';
 
 const authenticated = (request: Request, response: Response, next: NextFunction) => {
   const token = request.headers.authorization || '';
-  jwt.verify(token, config.JWT_SECRET, (error: VerifyErrors | null, _: any) => {
+  jwt.verify(token, config.JWT_SECRET, (error: VerifyErrors | null, decoded: any) => {
     if (error) {
-      response.json('Token not provided');
+      next(new ErrorHandler(401, 'Token not provided', ErrorCode.UNAUTHORIZED));
     } else {
+      response.locals.username = decoded.username;
       next();
     }
   });
@@ -22,4 +24,4 @@ export const verifyToken = (token: string) => {
   }
 };
 
-export default authenticated;
\ No newline at end of file
+export default authenticated;
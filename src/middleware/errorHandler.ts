@@ -1,22 +1,81 @@
-import { Response } from "express";
+import { NextFunction, Request, Response } from "express";
+
+export enum ErrorCode {
+  INVALID_REQUEST = "ERR_INVALID_REQUEST",
+  UNAUTHORIZED = "ERR_UNAUTHORIZED",
+  FORBIDDEN = "ERR_FORBIDDEN",
+  ROUTE_NOT_FOUND = "ERR_ROUTE_NOT_FOUND",
+  GAME_NOT_FOUND = "ERR_GAME_NOT_FOUND",
+  GAME_FULL = "ERR_GAME_FULL",
+  GAME_ALREADY_STARTED = "ERR_GAME_ALREADY_STARTED",
+  NOT_ENOUGH_PLAYERS = "ERR_NOT_ENOUGH_PLAYERS",
+  PLAYER_NOT_FOUND = "ERR_PLAYER_NOT_FOUND",
+  PLAYER_EXISTS = "ERR_PLAYER_EXISTS",
+  BANNED = "ERR_BANNED",
+  BAN_NOT_FOUND = "ERR_BAN_NOT_FOUND",
+  REPORT_NOT_FOUND = "ERR_REPORT_NOT_FOUND",
+  REQUEST_IN_PROGRESS = "ERR_REQUEST_IN_PROGRESS",
+  RATE_LIMITED = "ERR_RATE_LIMITED",
+  INTERNAL = "ERR_INTERNAL",
+};
 
 export class ErrorHandler extends Error {
   statusCode: number;
   message: string;
+  code: ErrorCode;
+  context?: Record<string, unknown>;
 
-  constructor(statusCode: number, message: string) {
+  constructor(statusCode: number, message: string, code: ErrorCode = ErrorCode.INVALID_REQUEST, context?: Record<string, unknown>) {
     super();
     this.statusCode = statusCode;
     this.message = message;
+    this.code = code;
+    this.context = context;
   }
 }
 
+const MAX_RECENT_ERRORS = 20;
+
+export const recentErrors: { at: Date, statusCode: number, code: ErrorCode, message: string }[] = [];
+
+export const recordError = ({ statusCode, code, message }: ErrorHandler) => {
+  recentErrors.unshift({ at: new Date(), statusCode, code, message });
+  recentErrors.splice(MAX_RECENT_ERRORS);
+};
+
 export const handleError = (error: ErrorHandler, response: Response) => {
-  const { statusCode, message } = error;
+  const { statusCode, message, code, context } = error;
+  recordError(error);
   response.status(statusCode).json({
     status: 'error',
     success: false,
     statusCode,
+    code,
     message,
+    context,
   });
-};
\ No newline at end of file
+};
+
+// client errors raised by other middleware, e.g. body-parser's entity.parse.failed, carry their own status
+const clientStatus = (error: Error & { status?: number, statusCode?: number }) => {
+  const status = error.statusCode || error.status;
+  return status && status >= 400 && status < 500 ? status : undefined;
+};
+
+// registered last so rejected route handlers end up here instead of hanging;
+// anything unexpected is logged and answered generically so driver messages never reach the client
+export const errorMiddleware = (error: Error, _: Request, response: Response, next: NextFunction) => {
+  if (response.headersSent) {
+    return next(error);
+  }
+  if (error instanceof ErrorHandler) {
+    return handleError(error, response);
+  }
+
+  const status = clientStatus(error);
+  if (status) {
+    return handleError(new ErrorHandler(status, error.message), response);
+  }
+  console.error(error);
+  handleError(new ErrorHandler(500, 'internal error', ErrorCode.INTERNAL), response);
+};
@@ -0,0 +1,57 @@
+import { NextFunction, Request, Response } from 'express';
+import { verifyToken } from './authenticated';
+import { ErrorCode, ErrorHandler } from './errorHandler';
+
+const TTL = 10 * 60 * 1000;
+
+// entries without a status are still in flight
+const seen = new Map<string, { at: number, status?: number, body?: unknown }>();
+
+// replays the first successful response for a repeated Idempotency-Key so client retries can't double-submit
+const idempotent = (request: Request, response: Response, next: NextFunction) => {
+  const key = request.header('Idempotency-Key');
+  if (!key || request.method === 'GET') {
+    return next();
+  }
+
+  const now = Date.now();
+  seen.forEach((entry, id) => {
+    if (now - entry.at > TTL) {
+      seen.delete(id);
+    }
+  });
+
+  // keys are only unique per client, so two clients picking the same key don't see each other's responses
+  const decoded = verifyToken(request.headers.authorization || '') as { username?: string } | false;
+  const client = (decoded && decoded.username) || request.ip;
+  const id = `${client} ${request.method} ${request.originalUrl} ${key}`;
+  const previous = seen.get(id);
+  if (previous) {
+    if (previous.status === undefined) {
+      return next(new ErrorHandler(409, 'a request with this Idempotency-Key is still in progress', ErrorCode.REQUEST_IN_PROGRESS));
+    }
+    response.set('Idempotent-Replay', 'true');
+    return response.status(previous.status).json(previous.body);
+  }
+
+  const pending = { at: now };
+  seen.set(id, pending);
+  // failures aren't cached, so the client can retry them with the same key
+  const json = response.json.bind(response);
+  response.json = (body: unknown) => {
+    if (response.statusCode >= 200 && response.statusCode < 300) {
+      seen.set(id, { at: now, status: response.statusCode, body: JSON.parse(JSON.stringify(body)) });
+    } else if (seen.get(id) === pending) {
+      seen.delete(id);
+    }
+    return json(body);
+  };
+  response.on('close', () => {
+    if (seen.get(id) === pending) {
+      seen.delete(id);
+    }
+  });
+  next();
+};
+
+export default idempotent;
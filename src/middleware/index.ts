@@ -1,2 +1,4 @@
+export { default as admin, isAdmin } from './admin';
 export { default as authenticated, verifyToken } from './authenticated';
-export { handleError, ErrorHandler } from './errorHandler';
+export { default as idempotent } from './idempotent';
+export { handleError, errorMiddleware, recordError, recentErrors, ErrorHandler, ErrorCode } from './errorHandler';
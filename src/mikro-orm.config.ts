@@ -1,11 +1,13 @@
 import { Options } from '@mikro-orm/core';
-import { Game, Player, BaseEntity } from './entities';
+import { Ban, Game, Player, Report, BaseEntity } from './entities';
+import { config } from './config';
 
 const options: Options = {
     type: 'mongo',
-    entities: [Game, Player, BaseEntity],
-    dbName: 'power-grid-game',
-    debug: true,
+    entities: [Ban, Game, Player, Report, BaseEntity],
+    clientUrl: config.DB_URL,
+    dbName: config.DB_NAME,
+    debug: config.DB_DEBUG,
 };
 
 export default options;
\ No newline at end of file
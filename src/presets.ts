@@ -0,0 +1,26 @@
+import { GamePreset, GameSettings } from "./types";
+
+const standardEndGameCities = { 2: 21, 3: 17, 4: 17, 5: 15, 6: 14 };
+
+const presets: Record<GamePreset, GameSettings> = {
+  [GamePreset.BLITZ]: {
+    turnTimerSeconds: 45,
+    endGameCities: { 2: 15, 3: 13, 4: 13, 5: 11, 6: 10 },
+  },
+  [GamePreset.STANDARD]: {
+    turnTimerSeconds: 120,
+    endGameCities: standardEndGameCities,
+  },
+  [GamePreset.MARATHON]: {
+    turnTimerSeconds: 600,
+    endGameCities: standardEndGameCities,
+  },
+};
+
+export const isGamePreset = (value: unknown): value is GamePreset =>
+  Object.values(GamePreset).includes(value as GamePreset);
+
+export const presetSettings = (preset: GamePreset): GameSettings => ({
+  turnTimerSeconds: presets[preset].turnTimerSeconds,
+  endGameCities: { ...presets[preset].endGameCities },
+});
@@ -3,27 +3,128 @@ import * as winston from 'winston';
 import * as expressWinston from 'express-winston';
 import cors from 'cors'
 import debug from 'debug';
-import { MikroORM, RequestContext, EntityManager, EntityRepository } from '@mikro-orm/core';
-import { Game, Player } from './entities';
-import { GameController, PlayerController } from './controllers';
-import { Server } from 'socket.io';
+import { MikroORM, RequestContext, EntityManager, EntityRepository, QueryOrder } from '@mikro-orm/core';
+import { Ban, Game, Player, Report } from './entities';
+import { AdminController, ExportController, GameController, MapController, PlayerController } from './controllers';
+import { errorMiddleware, idempotent, recordError, ErrorCode, ErrorHandler } from './middleware';
+import { expireIdleGames, expiredGames } from './managers/lobbyManager';
+import { findActiveBan } from './managers/moderationManager';
+import { Server, Socket } from 'socket.io';
+import { config } from './config';
 
 import http from 'http';
 
+const corsOptions: cors.CorsOptions = {
+  origin: config.CORS_ORIGINS.includes('*') ? true : config.CORS_ORIGINS,
+};
+
+// the cors headers only matter to browsers that honour them, so the socket handshake checks the origin itself
+const originAllowed = (origin?: string) =>
+  !origin || config.CORS_ORIGINS.includes('*') || config.CORS_ORIGINS.includes(origin);
+
 const server = http.createServer();
-const io = new Server(server);
+export const io = new Server(server, {
+  cors: corsOptions,
+  allowRequest: (req, callback) => callback(null, originAllowed(req.headers.origin)),
+  pingInterval: config.SOCKET_PING_INTERVAL,
+  pingTimeout: config.SOCKET_PING_TIMEOUT,
+});
+
+interface SessionStats {
+  id: string;
+  address: string;
+  connectedAt: Date;
+  messagesIn: number;
+  messagesOut: number;
+  bytesIn: number;
+  bytesOut: number;
+  lastEvent?: string;
+  lastMessageAt?: Date;
+  rtt?: number;
+}
+
+export const sessionStats = new Map<string, SessionStats>();
+
+// the left-most x-forwarded-for entry is the client, matching what express reports as req.ip with trust proxy on
+export const clientAddress = (handshake: { address: string, headers: Record<string, string | string[] | undefined> }) => {
+  const forwarded = handshake.headers['x-forwarded-for'];
+  if (config.TRUST_PROXY && typeof forwarded === 'string' && forwarded) {
+    return forwarded.split(',')[0].trim();
+  }
+  return handshake.address;
+};
+
+const packetSize = (data: unknown) => {
+  if (typeof data === 'string') {
+    return Buffer.byteLength(data);
+  }
+  return Buffer.isBuffer(data) ? data.length : 0;
+};
+
+// counts traffic at the engine.io packet level, and times ping -> pong for RTT
+const trackSession = (socket: Socket) => {
+  const stats: SessionStats = {
+    id: socket.id,
+    address: clientAddress(socket.handshake),
+    connectedAt: new Date(),
+    messagesIn: 0,
+    messagesOut: 0,
+    bytesIn: 0,
+    bytesOut: 0,
+  };
+  sessionStats.set(socket.id, stats);
+
+  let pingSentAt = 0;
+  socket.conn.on('packetCreate', (packet: { type: string, data?: unknown }) => {
+    stats.bytesOut += packetSize(packet.data);
+    if (packet.type === 'ping') {
+      pingSentAt = Date.now();
+    } else if (packet.type === 'message') {
+      stats.messagesOut++;
+    }
+  });
+  socket.conn.on('packet', (packet: { type: string, data?: unknown }) => {
+    stats.bytesIn += packetSize(packet.data);
+    if (packet.type === 'pong' && pingSentAt) {
+      stats.rtt = Date.now() - pingSentAt;
+    }
+  });
+  socket.onAny((event: string) => {
+    stats.messagesIn++;
+    stats.lastEvent = event;
+    stats.lastMessageAt = new Date();
+  });
+};
+
+export let socketHandlerCrashes = 0;
 
-const connections = [];
+// keeps a throwing (or rejecting) handler from taking the connection down with it
+const guarded = <T extends unknown[]>(socket: Socket, event: string, handler: (...args: T) => void | Promise<void>) => (...args: T) => {
+  const report = (e: Error) => {
+    socketHandlerCrashes++;
+    recordError(new ErrorHandler(500, `socket ${event} handler failed: ${e.message}`, ErrorCode.INTERNAL));
+    console.error(e);
+    socket.send(JSON.stringify({ error: { code: ErrorCode.INTERNAL, message: 'internal error' } }));
+  };
+  try {
+    Promise.resolve(handler(...args)).catch(report);
+  } catch (e) {
+    report(e);
+  }
+};
 
 const app: express.Application = express();
-const port = process.env.PORT || 3000;
+const port = config.API_PORT;
 const debugLog: debug.IDebugger = debug('app');
+const lobbyLog: debug.IDebugger = debug('app:lobby');
 
 export const DI = {} as {
   orm: MikroORM,
   em: EntityManager,
   playerRepository: EntityRepository<Player>,
   gameRepository: EntityRepository<Game>,
+  banRepository: EntityRepository<Ban>,
+  reportRepository: EntityRepository<Report>,
 };
 
 const loggerOptions: expressWinston.LoggerOptions = {
@@ -44,19 +145,60 @@ if (!process.env.DEBUG) {
   DI.em = DI.orm.em;
   DI.playerRepository = DI.orm.em.getRepository(Player);
   DI.gameRepository = DI.orm.em.getRepository(Game);
+  DI.banRepository = DI.orm.em.getRepository(Ban);
+  DI.reportRepository = DI.orm.em.getRepository(Report);
   
+  app.set('trust proxy', config.TRUST_PROXY);
   app.use(express.json())
-  app.use(cors());
+  app.use(cors(corsOptions));
   app.use(expressWinston.logger(loggerOptions));
   app.use((req, res, next) => RequestContext.create(DI.orm.em, next));
-  app.get('/', (req, res) => res.json({ message: "This is a game server for Power Grid: USA"}));
+  app.use(idempotent);
+  app.get('/', async (req, res, next) => {
+    try {
+      const [activeGames, openGames, featured] = await Promise.all([
+        DI.gameRepository.count({ gamePhase: { $gt: 0 } }),
+        DI.gameRepository.count({ gamePhase: 0 }),
+        DI.gameRepository.find({ gamePhase: 0, isPrivate: { $ne: true } }, { orderBy: { createdAt: QueryOrder.DESC }, limit: 5 }),
+      ]);
+      res.json({
+        message: "This is a game server for Power Grid: USA",
+        motd: config.MOTD,
+        connectedClients: io.engine.clientsCount,
+        activeGames,
+        openGames,
+        featuredGames: featured.map(game => game.code),
+        expiredGames,
+      });
+    } catch (e) {
+      next(e);
+    }
+  });
   app.use('/game', GameController);
   app.use('/player', PlayerController);
-  app.use((req, res) => res.status(404).json({ message: 'No route found'}));
+  app.use('/export', ExportController);
+  app.use('/map', MapController);
+  app.use('/admin', AdminController);
+  app.use((req, res, next) => next(new ErrorHandler(404, 'No route found', ErrorCode.ROUTE_NOT_FOUND)));
+  app.use(errorMiddleware);
 
   server.on('request', app);
+  io.use(async (socket, next) => {
+    try {
+      const ban = await findActiveBan(DI.orm.em.fork(), { ip: clientAddress(socket.handshake) });
+      next(ban ? new Error(`banned: ${ban.reason}`) : undefined);
+    } catch (e) {
+      next(e);
+    }
+  });
   io.on('connection', (socket) => {
-    socket.on('message', (message: string) => {
+    trackSession(socket);
+    // socket.io disconnects after a missed pong, so this also reaps dead clients
+    socket.on('disconnect', (reason: string) => {
+      sessionStats.delete(socket.id);
+      debugLog(`socket ${socket.id} disconnected: ${reason}`);
+    });
+    socket.on('message', guarded(socket, 'message', (message: string) => {
       console.log(`message: ${message}`);
       try {
         const num = JSON.parse(message).test;
@@ -67,9 +209,20 @@ if (!process.env.DEBUG) {
       socket.send(JSON.stringify({
         answer: 42
       }));
-    });
+    }));
   });
   server.listen(port, () => {
     console.log(`http/ws server listening on ${port}`);
   });
+
+  setInterval(async () => {
+    try {
+      const codes = await expireIdleGames();
+      if (codes.length) {
+        lobbyLog(`expired idle games: ${codes.join(', ')}`);
+      }
+    } catch (e) {
+      console.error(e.message);
+    }
+  }, 60 * 1000);
 })();
@@ -8,6 +8,18 @@ export enum Resource {
   GREEN = "GREEN",
 };
 
+export enum GamePreset {
+  BLITZ = "blitz",
+  STANDARD = "standard",
+  MARATHON = "marathon",
+};
+
+export interface GameSettings {
+  turnTimerSeconds: number;
+  // cities that trigger the end of the game, keyed by player count
+  endGameCities: Record<number, number>;
+}
+
 export interface PowerPlant {
   initialCost: number;
   resourcesRequired: number;